@@ -0,0 +1,528 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestOIDC_GenerateSigningKey_AllAlgorithms(t *testing.T) {
+	algs := []signingAlgorithm{
+		rs256, rs384, rs512,
+		ps256, ps384, ps512,
+		es256, es384, es512,
+		edDSA,
+	}
+
+	for _, alg := range algs {
+		alg := alg
+		t.Run(alg.String(), func(t *testing.T) {
+			priv, pub, err := generateSigningKey(alg)
+			if err != nil {
+				t.Fatalf("generateSigningKey(%s) returned error: %v", alg, err)
+			}
+
+			signer, err := jose.NewSigner(jose.SigningKey{
+				Algorithm: jose.SignatureAlgorithm(priv.Algorithm),
+				Key:       &priv,
+			}, nil)
+			if err != nil {
+				t.Fatalf("failed to construct signer for %s: %v", alg, err)
+			}
+
+			payload, err := json.Marshal(map[string]interface{}{"sub": "test-subject"})
+			if err != nil {
+				t.Fatalf("failed to marshal payload: %v", err)
+			}
+
+			signature, err := signer.Sign(payload)
+			if err != nil {
+				t.Fatalf("failed to sign payload with %s: %v", alg, err)
+			}
+
+			jws, err := signature.CompactSerialize()
+			if err != nil {
+				t.Fatalf("failed to serialize jws: %v", err)
+			}
+
+			parsed, err := jose.ParseSigned(jws)
+			if err != nil {
+				t.Fatalf("failed to parse jws: %v", err)
+			}
+
+			verified, err := parsed.Verify(&pub)
+			if err != nil {
+				t.Fatalf("failed to verify jws with exported public JWK for %s: %v", alg, err)
+			}
+
+			if string(verified) != string(payload) {
+				t.Fatalf("verified payload mismatch for %s: got %s, want %s", alg, verified, payload)
+			}
+		})
+	}
+}
+
+// TestOIDC_NamedKeyUnmarshalJSON_Legacy is a regression test for decoding a
+// NamedKey stored in the baseline shape, before key rotation introduced
+// ExpireableKey ring entries, when key_ring was just a single-element list
+// of the signing key's own KeyID. Without NamedKey.UnmarshalJSON's fallback
+// to legacyNamedKey, this fails with a JSON type error and breaks
+// migrateLegacyOIDCPublicKeys, loadOIDCCache, and startOIDCRotation for any
+// deployment upgrading with a pre-existing named key in storage.
+func TestOIDC_NamedKeyUnmarshalJSON_Legacy(t *testing.T) {
+	priv, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+
+	legacy := legacyNamedKey{
+		Name:             "default",
+		SigningAlgorithm: rs256,
+		Verificationttl:  "1h",
+		RotationPeriod:   "6h",
+		KeyRing:          []string{priv.KeyID},
+		SigningKey:       priv,
+	}
+
+	entry, err := logical.StorageEntryJSON("oidc-config/namedKey/default", &legacy)
+	if err != nil {
+		t.Fatalf("failed to build storage entry: %v", err)
+	}
+
+	var namedKey NamedKey
+	if err := entry.DecodeJSON(&namedKey); err != nil {
+		t.Fatalf("failed to decode baseline-shaped NamedKey: %v", err)
+	}
+
+	if namedKey.Name != legacy.Name || namedKey.RotationPeriod != legacy.RotationPeriod || namedKey.Verificationttl != legacy.Verificationttl {
+		t.Fatalf("decoded NamedKey lost scalar fields: got %+v", namedKey)
+	}
+	if namedKey.SigningKey.KeyID != priv.KeyID {
+		t.Fatalf("decoded NamedKey lost signing key: got %+v", namedKey.SigningKey)
+	}
+	if len(namedKey.KeyRing) != 0 {
+		t.Fatalf("expected legacy key_ring to be dropped since it carries no information beyond the signing key's own KeyID, got %v", namedKey.KeyRing)
+	}
+}
+
+// TestOIDC_MigrateLegacyOIDCPublicKeys verifies that a legacy
+// oidc-config/publicKeys/ entry - written back when a baseline-shaped
+// NamedKey still lived alongside it - is merged into the owning named
+// key's key ring and removed, and that the current signing key's own
+// public part is skipped since it's already derivable from SigningKey.
+func TestOIDC_MigrateLegacyOIDCPublicKeys(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	priv, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+	oldPriv, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+
+	namedKey := &NamedKey{
+		Name:             "default",
+		SigningAlgorithm: rs256,
+		Verificationttl:  "1h",
+		RotationPeriod:   "6h",
+		SigningKey:       priv,
+	}
+	entry, err := logical.StorageEntryJSON("oidc-config/namedKey/default", namedKey)
+	if err != nil {
+		t.Fatalf("failed to build named key entry: %v", err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatalf("failed to store named key: %v", err)
+	}
+
+	legacyKeys := []ExpireableKey{
+		{Key: publicPart(priv), Expirable: false},
+		{Key: publicPart(oldPriv), Expirable: true, ExpireAt: time.Now().Add(time.Hour)},
+	}
+	legacyEntry, err := logical.StorageEntryJSON("oidc-config/publicKeys/", legacyKeys)
+	if err != nil {
+		t.Fatalf("failed to build legacy publicKeys entry: %v", err)
+	}
+	if err := storage.Put(ctx, legacyEntry); err != nil {
+		t.Fatalf("failed to store legacy publicKeys entry: %v", err)
+	}
+
+	i := &IdentityStore{}
+	if err := i.migrateLegacyOIDCPublicKeys(ctx, storage); err != nil {
+		t.Fatalf("migrateLegacyOIDCPublicKeys returned error: %v", err)
+	}
+
+	if gotEntry, err := storage.Get(ctx, "oidc-config/publicKeys/"); err != nil {
+		t.Fatalf("failed to read back publicKeys entry: %v", err)
+	} else if gotEntry != nil {
+		t.Fatalf("expected legacy publicKeys entry to be deleted after migration")
+	}
+
+	nkEntry, err := storage.Get(ctx, "oidc-config/namedKey/default")
+	if err != nil {
+		t.Fatalf("failed to read back named key: %v", err)
+	}
+	if nkEntry == nil {
+		t.Fatalf("expected named key entry to still exist")
+	}
+
+	var got NamedKey
+	if err := nkEntry.DecodeJSON(&got); err != nil {
+		t.Fatalf("failed to decode migrated named key: %v", err)
+	}
+
+	if len(got.KeyRing) != 1 {
+		t.Fatalf("expected exactly the previously-rotated key to be migrated into the ring, got %v", got.KeyRing)
+	}
+	if got.KeyRing[0].Key.KeyID != oldPriv.KeyID {
+		t.Fatalf("migrated key ring entry has wrong KeyID: got %s, want %s", got.KeyRing[0].Key.KeyID, oldPriv.KeyID)
+	}
+}
+
+// TestOIDC_HandleOIDCReadPublicKeys_MaxAge verifies that the JWKS
+// Cache-Control max-age reflects whichever is sooner: a key ring entry's
+// expiry, or a named key's own signing key rotation deadline. A named key
+// that hasn't rotated yet has no Expirable ring entries, so the rotation
+// deadline is the only signal that the JWKS will change.
+func TestOIDC_HandleOIDCReadPublicKeys_MaxAge(t *testing.T) {
+	i := &IdentityStore{}
+
+	unrotated, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+	i.oidcState().keyCache.set("unrotated", &NamedKey{
+		Name:                "unrotated",
+		SigningAlgorithm:    rs256,
+		RotationPeriod:      "1h",
+		SigningKey:          unrotated,
+		SigningKeyCreatedAt: time.Now(),
+	})
+
+	rotated, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+	oldPub, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+	i.oidcState().keyCache.set("rotated", &NamedKey{
+		Name:                "rotated",
+		SigningAlgorithm:    rs256,
+		RotationPeriod:      "24h",
+		SigningKey:          rotated,
+		SigningKeyCreatedAt: time.Now(),
+		KeyRing: []ExpireableKey{
+			{Key: publicPart(oldPub), Expirable: true, ExpireAt: time.Now().Add(10 * time.Minute)},
+		},
+	})
+
+	resp, err := i.handleOIDCReadPublicKeys()(context.Background(), &logical.Request{}, nil)
+	if err != nil {
+		t.Fatalf("handleOIDCReadPublicKeys returned error: %v", err)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks); err != nil {
+		t.Fatalf("failed to parse jwks body: %v", err)
+	}
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("expected 3 published keys (2 signing keys + 1 ring entry), got %d", len(jwks.Keys))
+	}
+
+	// The 10-minute ring expiry is sooner than unrotated's 1h rotation
+	// deadline, so it should win.
+	wantMaxAge := 10 * time.Minute
+	gotCacheControl := resp.Data[logical.HTTPCacheControl].(string)
+	if gotCacheControl != fmt.Sprintf("max-age=%d", int(wantMaxAge.Seconds())) {
+		t.Fatalf("unexpected Cache-Control: got %q, want max-age=%d", gotCacheControl, int(wantMaxAge.Seconds()))
+	}
+}
+
+// TestOIDC_RotateNamedKey verifies that rotating a named key generates a
+// new signing key while moving the previous signing key's public part
+// into the key ring with an expiry of now + verification_ttl, so
+// outstanding tokens signed by it can still be verified.
+func TestOIDC_RotateNamedKey(t *testing.T) {
+	priv, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+
+	namedKey := &NamedKey{
+		SigningAlgorithm: rs256,
+		Verificationttl:  "1h",
+		SigningKey:       priv,
+	}
+
+	i := &IdentityStore{}
+	before := time.Now()
+	if err := i.rotateNamedKey(namedKey); err != nil {
+		t.Fatalf("rotateNamedKey returned error: %v", err)
+	}
+
+	if namedKey.SigningKey.KeyID == priv.KeyID {
+		t.Fatalf("expected a new signing key to be generated")
+	}
+	if namedKey.SigningKeyCreatedAt.Before(before) {
+		t.Fatalf("expected SigningKeyCreatedAt to be updated")
+	}
+	if len(namedKey.KeyRing) != 1 {
+		t.Fatalf("expected the previous signing key to be added to the ring, got %v", namedKey.KeyRing)
+	}
+	if namedKey.KeyRing[0].Key.KeyID != priv.KeyID {
+		t.Fatalf("expected the ring entry to carry the previous signing key's KeyID")
+	}
+	if !namedKey.KeyRing[0].Expirable {
+		t.Fatalf("expected the ring entry to be expirable")
+	}
+	if namedKey.KeyRing[0].ExpireAt.Before(before.Add(59 * time.Minute)) {
+		t.Fatalf("expected the ring entry to expire roughly 1h from now, got %v", namedKey.KeyRing[0].ExpireAt)
+	}
+}
+
+// TestOIDC_PruneExpiredKeyRing verifies that only key ring entries whose
+// ExpireAt has passed are removed, and that the non-expirable current
+// signing key's public part (Expirable: false) is never pruned.
+func TestOIDC_PruneExpiredKeyRing(t *testing.T) {
+	expired, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+	current, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+	future, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+
+	namedKey := &NamedKey{
+		KeyRing: []ExpireableKey{
+			{Key: publicPart(expired), Expirable: true, ExpireAt: time.Now().Add(-time.Minute)},
+			{Key: publicPart(current), Expirable: false},
+			{Key: publicPart(future), Expirable: true, ExpireAt: time.Now().Add(time.Hour)},
+		},
+	}
+
+	if changed := pruneExpiredKeyRing(namedKey); !changed {
+		t.Fatalf("expected pruneExpiredKeyRing to report a change")
+	}
+
+	if len(namedKey.KeyRing) != 2 {
+		t.Fatalf("expected 2 remaining ring entries, got %d: %v", len(namedKey.KeyRing), namedKey.KeyRing)
+	}
+	for _, key := range namedKey.KeyRing {
+		if key.Key.KeyID == expired.KeyID {
+			t.Fatalf("expired ring entry was not pruned")
+		}
+	}
+
+	if changed := pruneExpiredKeyRing(namedKey); changed {
+		t.Fatalf("expected no further change once nothing is expired")
+	}
+}
+
+// TestOIDC_RenderOIDCClaimsTemplate verifies that a role's claims template
+// substitutes entity, group, and alias placeholders - including a
+// whole-value placeholder resolving to its underlying typed value rather
+// than a stringified one. Rejection of reserved claims is covered by
+// TestOIDC_RenderOIDCClaimsTemplate_ReservedClaim.
+func TestOIDC_RenderOIDCClaimsTemplate(t *testing.T) {
+	entity := &identity.Entity{
+		ID:   "entity-id",
+		Name: "entity-name",
+		Aliases: []*identity.Alias{
+			{MountAccessor: "auth_okta_1234", Name: "alice@example.com"},
+		},
+	}
+	groups := []*identity.Group{
+		{Name: "engineering"},
+		{Name: "on-call"},
+	}
+
+	template := map[string]interface{}{
+		"username": "{{identity.entity.name}}",
+		"greeting": "hello, {{identity.entity.name}}",
+		"groups":   "{{identity.entity.groups.names}}",
+		"okta":     "{{identity.entity.aliases.auth_okta_1234.name}}",
+	}
+	raw, err := json.Marshal(template)
+	if err != nil {
+		t.Fatalf("failed to marshal template: %v", err)
+	}
+	templateB64 := base64.StdEncoding.EncodeToString(raw)
+
+	claims, err := renderOIDCClaimsTemplate(templateB64, entity, groups)
+	if err != nil {
+		t.Fatalf("renderOIDCClaimsTemplate returned error: %v", err)
+	}
+
+	if claims["username"] != "entity-name" {
+		t.Fatalf("unexpected username claim: %v", claims["username"])
+	}
+	if claims["greeting"] != "hello, entity-name" {
+		t.Fatalf("unexpected greeting claim: %v", claims["greeting"])
+	}
+	if claims["okta"] != "alice@example.com" {
+		t.Fatalf("unexpected okta claim: %v", claims["okta"])
+	}
+
+	names, ok := claims["groups"].([]string)
+	if !ok || len(names) != 2 || names[0] != "engineering" || names[1] != "on-call" {
+		t.Fatalf("expected groups claim to resolve to the underlying []string, got %#v", claims["groups"])
+	}
+}
+
+// TestOIDC_RenderOIDCClaimsTemplate_ReservedClaim verifies that a template
+// attempting to set a claim handleOIDCGenerateToken always sets itself
+// (e.g. "sub") is rejected rather than silently overriding it.
+func TestOIDC_RenderOIDCClaimsTemplate_ReservedClaim(t *testing.T) {
+	raw, err := json.Marshal(map[string]interface{}{"sub": "not-allowed"})
+	if err != nil {
+		t.Fatalf("failed to marshal template: %v", err)
+	}
+	templateB64 := base64.StdEncoding.EncodeToString(raw)
+
+	if _, err := renderOIDCClaimsTemplate(templateB64, &identity.Entity{}, nil); err == nil {
+		t.Fatalf("expected an error for a template setting the reserved \"sub\" claim")
+	}
+}
+
+// verifyOIDCTestToken signs a set of claims with priv and returns the
+// compact-serialized JWT, for use by the VerifyOIDCToken tests below.
+func verifyOIDCTestToken(t *testing.T, priv jose.JSONWebKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(priv.Algorithm),
+		Key:       &priv,
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to construct signer: %v", err)
+	}
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	jws, err := signature.CompactSerialize()
+	if err != nil {
+		t.Fatalf("failed to serialize token: %v", err)
+	}
+	return jws
+}
+
+// TestOIDC_VerifyOIDCToken covers VerifyOIDCToken's success path and each
+// of its typed error paths, so that callers relying on errors.Is to react
+// to a specific failure (e.g. a JWT auth method retrying on ErrExpired)
+// keep working.
+func TestOIDC_VerifyOIDCToken(t *testing.T) {
+	priv, _, err := generateSigningKey(rs256)
+	if err != nil {
+		t.Fatalf("generateSigningKey returned error: %v", err)
+	}
+
+	i := &IdentityStore{}
+	i.oidcState().keyCache.set("default", &NamedKey{
+		Name:             "default",
+		SigningAlgorithm: rs256,
+		SigningKey:       priv,
+	})
+	i.oidcState().issuerCache.issuer = "https://vault.example.com/v1/identity/oidc"
+
+	now := time.Now()
+	baseClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": "https://vault.example.com/v1/identity/oidc",
+			"sub": "entity-id",
+			"aud": "my-client-id",
+			"exp": now.Add(time.Hour).Unix(),
+			"iat": now.Unix(),
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		jws := verifyOIDCTestToken(t, priv, baseClaims())
+
+		claims, err := i.VerifyOIDCToken(context.Background(), jws, VerifyOptions{ExpectedAudiences: []string{"my-client-id"}})
+		if err != nil {
+			t.Fatalf("VerifyOIDCToken returned error: %v", err)
+		}
+		if (*claims)["sub"] != "entity-id" {
+			t.Fatalf("unexpected sub claim: %v", (*claims)["sub"])
+		}
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		other, _, err := generateSigningKey(rs256)
+		if err != nil {
+			t.Fatalf("generateSigningKey returned error: %v", err)
+		}
+		jws := verifyOIDCTestToken(t, other, baseClaims())
+
+		if _, err := i.VerifyOIDCToken(context.Background(), jws, VerifyOptions{}); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		forged, _, err := generateSigningKey(rs256)
+		if err != nil {
+			t.Fatalf("generateSigningKey returned error: %v", err)
+		}
+		forged.KeyID = priv.KeyID
+		jws := verifyOIDCTestToken(t, forged, baseClaims())
+
+		if _, err := i.VerifyOIDCToken(context.Background(), jws, VerifyOptions{}); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("expected ErrBadSignature, got %v", err)
+		}
+	})
+
+	t.Run("invalid issuer", func(t *testing.T) {
+		claims := baseClaims()
+		claims["iss"] = "https://not-vault.example.com"
+		jws := verifyOIDCTestToken(t, priv, claims)
+
+		if _, err := i.VerifyOIDCToken(context.Background(), jws, VerifyOptions{}); !errors.Is(err, ErrInvalidIssuer) {
+			t.Fatalf("expected ErrInvalidIssuer, got %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		claims := baseClaims()
+		claims["exp"] = now.Add(-time.Hour).Unix()
+		jws := verifyOIDCTestToken(t, priv, claims)
+
+		if _, err := i.VerifyOIDCToken(context.Background(), jws, VerifyOptions{}); !errors.Is(err, ErrExpired) {
+			t.Fatalf("expected ErrExpired, got %v", err)
+		}
+	})
+
+	t.Run("audience mismatch", func(t *testing.T) {
+		jws := verifyOIDCTestToken(t, priv, baseClaims())
+
+		_, err := i.VerifyOIDCToken(context.Background(), jws, VerifyOptions{ExpectedAudiences: []string{"someone-else"}})
+		if !errors.Is(err, ErrAudienceMismatch) {
+			t.Fatalf("expected ErrAudienceMismatch, got %v", err)
+		}
+	})
+}